@@ -0,0 +1,311 @@
+// Package at implements the request/response and URC framing that real
+// AT-command modems use, on top of a *serial.Port.
+package at
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Conn is the subset of *serial.Port a Client needs: a byte stream to
+// read modem output from and a context-cancellable write. Tests satisfy
+// it with a fake so this package's framing logic doesn't require real
+// hardware.
+type Conn interface {
+	io.Reader
+	WriteContext(ctx context.Context, buf []byte) (int, error)
+}
+
+// Options configures a Client.
+type Options struct {
+	// LineTerminator is appended to every command sent with Send or
+	// SendPrompt. Defaults to "\r\n".
+	LineTerminator string
+
+	// Timeout bounds a Send/SendPrompt call when the caller's context
+	// carries no deadline of its own. Defaults to 5s.
+	Timeout time.Duration
+}
+
+// Response is the result of a command: any intermediate lines the modem
+// printed before the final result code, plus that code itself (e.g.
+// "OK", "ERROR", "+CME ERROR: 3").
+type Response struct {
+	Lines []string
+	Final string
+}
+
+// Client serializes AT commands over a Conn (typically a *serial.Port)
+// and dispatches unsolicited result codes (URCs) to subscribers
+// registered by prefix.
+type Client struct {
+	port Conn
+	opts Options
+
+	sendMu sync.Mutex
+
+	respCh   chan string
+	promptCh chan struct{}
+
+	// awaiting is set from just before a command is written until its
+	// collect call returns, so handleLine knows a final result code is
+	// still pending. Some query responses
+	// (e.g. "+CREG:") share a prefix with a URC of the same name, and a
+	// modem never interleaves URCs with the response to the command that
+	// just asked for that same information, so lines seen while awaiting
+	// is set always go to respCh rather than being diverted to a
+	// subscriber.
+	awaiting atomic.Bool
+
+	subMu sync.Mutex
+	subs  map[string][]chan string
+}
+
+// NewClient wraps p with AT framing. The returned Client owns a
+// background goroutine reading from p until it returns an error (e.g.
+// because p was closed).
+func NewClient(p Conn, opts Options) *Client {
+	if opts.LineTerminator == "" {
+		opts.LineTerminator = "\r\n"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	c := &Client{
+		port:     p,
+		opts:     opts,
+		respCh:   make(chan string, 32),
+		promptCh: make(chan struct{}, 1),
+		subs:     make(map[string][]chan string),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Subscribe registers for unsolicited result codes starting with prefix
+// (e.g. "+CMTI:", "RING"). The returned func unsubscribes and closes the
+// channel.
+func (c *Client) Subscribe(prefix string) (<-chan string, func()) {
+	ch := make(chan string, 16)
+	c.subMu.Lock()
+	c.subs[prefix] = append(c.subs[prefix], ch)
+	c.subMu.Unlock()
+
+	return ch, func() {
+		c.subMu.Lock()
+		defer c.subMu.Unlock()
+		subs := c.subs[prefix]
+		for i, s := range subs {
+			if s == ch {
+				c.subs[prefix] = append(subs[:i], subs[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+}
+
+// Send writes cmd, skips its echo if the modem has echo enabled, and
+// collects lines until a final result code is seen.
+func (c *Client) Send(ctx context.Context, cmd string) (Response, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	// awaiting must flip before the write reaches the modem: readLoop
+	// runs concurrently, and if the response raced ahead of this store,
+	// handleLine would see awaiting still false and divert it to a URC
+	// subscriber sharing the same prefix instead of respCh.
+	c.awaiting.Store(true)
+	defer c.awaiting.Store(false)
+
+	if _, err := c.port.WriteContext(ctx, []byte(cmd+c.opts.LineTerminator)); err != nil {
+		return Response{}, err
+	}
+	return c.collect(ctx, cmd)
+}
+
+// SendPrompt writes cmd, waits for the modem's "> " prompt, then writes
+// payload terminated with Ctrl-Z (0x1A) — the framing PDU/SMS-mode
+// commands such as AT+CMGS use for their payload.
+func (c *Client) SendPrompt(ctx context.Context, cmd string, payload []byte) (Response, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	c.awaiting.Store(true)
+	defer c.awaiting.Store(false)
+
+	if _, err := c.port.WriteContext(ctx, []byte(cmd+c.opts.LineTerminator)); err != nil {
+		return Response{}, err
+	}
+
+	select {
+	case <-c.promptCh:
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+
+	if _, err := c.port.WriteContext(ctx, payload); err != nil {
+		return Response{}, err
+	}
+	if _, err := c.port.WriteContext(ctx, []byte{0x1A}); err != nil {
+		return Response{}, err
+	}
+
+	return c.collect(ctx, "")
+}
+
+// Escape emits the Hayes "+++" guard-time escape sequence to drop a data
+// call back to command mode, with the mandated 1s of silence either side.
+func (c *Client) Escape(ctx context.Context) error {
+	const guardTime = 1100 * time.Millisecond
+
+	if err := c.sleep(ctx, guardTime); err != nil {
+		return err
+	}
+
+	c.sendMu.Lock()
+	_, err := c.port.WriteContext(ctx, []byte("+++"))
+	c.sendMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return c.sleep(ctx, guardTime)
+}
+
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.opts.Timeout)
+}
+
+// collect reads lines from respCh until a final result code arrives,
+// skipping a single echoed copy of echo if it shows up first. The
+// caller is responsible for setting c.awaiting before its write reaches
+// the modem.
+func (c *Client) collect(ctx context.Context, echo string) (Response, error) {
+
+	var resp Response
+	echoSeen := echo == ""
+	for {
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case line := <-c.respCh:
+			if !echoSeen && line == echo {
+				echoSeen = true
+				continue
+			}
+			if final, ok := finalResultCode(line); ok {
+				resp.Final = final
+				return resp, nil
+			}
+			resp.Lines = append(resp.Lines, line)
+		}
+	}
+}
+
+func finalResultCode(line string) (string, bool) {
+	switch line {
+	case "OK", "ERROR", "NO CARRIER", "BUSY", "NO DIALTONE":
+		return line, true
+	}
+	if strings.HasPrefix(line, "+CME ERROR:") || strings.HasPrefix(line, "+CMS ERROR:") {
+		return line, true
+	}
+	return "", false
+}
+
+// readLoop is the sole reader of c.port. It scans byte by byte because
+// the "> " SMS prompt arrives with no trailing CRLF and would otherwise
+// deadlock a line-buffered reader waiting for one.
+func (c *Client) readLoop() {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := c.port.Read(b)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		switch b[0] {
+		case '\r':
+			// ignore; lines are terminated by \n
+		case '\n':
+			if len(line) > 0 {
+				c.handleLine(string(line))
+				line = line[:0]
+			}
+		default:
+			line = append(line, b[0])
+			if len(line) == 2 && line[0] == '>' && line[1] == ' ' {
+				select {
+				case c.promptCh <- struct{}{}:
+				default:
+				}
+				line = line[:0]
+			}
+		}
+	}
+}
+
+func (c *Client) handleLine(line string) {
+	if !c.awaiting.Load() {
+		// No Send is in flight, so this line can only be a URC (or
+		// noise); respCh is a single long-lived channel, not one
+		// recreated per Send, so writing to it here would sit in the
+		// buffer and get misread as part of whatever the next Send
+		// happens to be.
+		c.dispatchURC(line)
+		return
+	}
+	select {
+	case c.respCh <- line:
+	default:
+		// Nobody is waiting on respCh and the buffer is full; drop
+		// rather than block the reader forever.
+	}
+}
+
+func (c *Client) dispatchURC(line string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	for prefix, subs := range c.subs {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		for _, ch := range subs {
+			select {
+			case ch <- line:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package at
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeConn is a Conn backed by an in-memory pipe: feed writes bytes as
+// if the modem had sent them, and recorded commands can be inspected via
+// writes.
+type fakeConn struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newFakeConn() *fakeConn {
+	r, w := io.Pipe()
+	return &fakeConn{r: r, w: w}
+}
+
+func (f *fakeConn) Read(p []byte) (int, error) { return f.r.Read(p) }
+
+func (f *fakeConn) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+func (f *fakeConn) feed(s string) { f.w.Write([]byte(s)) }
+
+func TestFinalResultCode(t *testing.T) {
+	cases := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"OK", "OK", true},
+		{"ERROR", "ERROR", true},
+		{"NO CARRIER", "NO CARRIER", true},
+		{"BUSY", "BUSY", true},
+		{"NO DIALTONE", "NO DIALTONE", true},
+		{"+CME ERROR: 3", "+CME ERROR: 3", true},
+		{"+CMS ERROR: 500", "+CMS ERROR: 500", true},
+		{"+CREG: 0,1", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		got, ok := finalResultCode(c.line)
+		if got != c.want || ok != c.ok {
+			t.Errorf("finalResultCode(%q) = (%q, %v), want (%q, %v)", c.line, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestSendSkipsEchoAndCollectsLines(t *testing.T) {
+	fc := newFakeConn()
+	c := NewClient(fc, Options{Timeout: time.Second})
+
+	resp, err := sendAndFeed(t, c, fc, "AT+CREG?", []string{
+		"AT+CREG?\r\n",
+		"+CREG: 0,1\r\n",
+		"OK\r\n",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp.Final != "OK" || len(resp.Lines) != 1 || resp.Lines[0] != "+CREG: 0,1" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+// TestSendResponseNotDivertedToURCSubscriber guards against the command
+// response being silently diverted to a URC subscriber sharing its
+// prefix, e.g. a caller awaiting "AT+CREG?" while also subscribed to
+// "+CREG:" URCs.
+func TestSendResponseNotDivertedToURCSubscriber(t *testing.T) {
+	fc := newFakeConn()
+	c := NewClient(fc, Options{Timeout: time.Second})
+
+	urc, unsub := c.Subscribe("+CREG:")
+	defer unsub()
+
+	resp, err := sendAndFeed(t, c, fc, "AT+CREG?", []string{
+		"AT+CREG?\r\n",
+		"+CREG: 0,1\r\n",
+		"OK\r\n",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(resp.Lines) != 1 || resp.Lines[0] != "+CREG: 0,1" {
+		t.Fatalf("response line was diverted away from Send: %+v", resp)
+	}
+	select {
+	case line := <-urc:
+		t.Fatalf("unexpected URC delivery during an in-flight command: %q", line)
+	default:
+	}
+}
+
+func TestURCDispatchedWhenIdle(t *testing.T) {
+	fc := newFakeConn()
+	c := NewClient(fc, Options{Timeout: time.Second})
+
+	urc, unsub := c.Subscribe("+CREG:")
+	defer unsub()
+
+	fc.feed("+CREG: 0,1\r\n")
+
+	select {
+	case line := <-urc:
+		if line != "+CREG: 0,1" {
+			t.Fatalf("got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("URC was not dispatched")
+	}
+}
+
+// TestIdleUnmatchedLineNotLeakedIntoNextSend guards against an unsolicited
+// line with no subscriber, seen while idle, sitting in respCh's buffer
+// and being misread as part of the next Send's response. handleLine is
+// called directly (rather than fed through the pipe) so the test isn't
+// racing the background readLoop goroutine to land the line before the
+// next Send starts.
+func TestIdleUnmatchedLineNotLeakedIntoNextSend(t *testing.T) {
+	fc := newFakeConn()
+	c := NewClient(fc, Options{Timeout: time.Second})
+
+	c.handleLine("SOME UNEXPECTED BANNER")
+	if len(c.respCh) != 0 {
+		t.Fatalf("idle unmatched line was enqueued on respCh: len=%d", len(c.respCh))
+	}
+
+	resp, err := sendAndFeed(t, c, fc, "AT+CREG?", []string{
+		"AT+CREG?\r\n",
+		"+CREG: 0,1\r\n",
+		"OK\r\n",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(resp.Lines) != 1 || resp.Lines[0] != "+CREG: 0,1" {
+		t.Fatalf("stale idle line leaked into response: %+v", resp)
+	}
+}
+
+// sendAndFeed runs c.Send(ctx, cmd) in the background while feeding lines
+// into fc, and returns once Send completes or the test times out.
+func sendAndFeed(t *testing.T, c *Client, fc *fakeConn, cmd string, lines []string) (Response, error) {
+	t.Helper()
+
+	type result struct {
+		resp Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := c.Send(context.Background(), cmd)
+		done <- result{resp, err}
+	}()
+
+	for _, l := range lines {
+		fc.feed(l)
+	}
+
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-time.After(time.Second):
+		t.Fatal("Send did not return")
+		return Response{}, nil
+	}
+}
@@ -0,0 +1,138 @@
+// Package serial opens and configures serial/COM ports, backed by IOCP
+// overlapped I/O on Windows and termios on POSIX.
+package serial
+
+import (
+	"errors"
+	"time"
+)
+
+// Parity selects the parity bit scheme used on the wire.
+type Parity int
+
+const (
+	ParityNone Parity = iota
+	ParityOdd
+	ParityEven
+	ParityMark
+	ParitySpace
+)
+
+// StopBits selects the number of stop bits used to frame each byte.
+type StopBits int
+
+const (
+	Stop1 StopBits = iota
+	Stop1Half
+	Stop2
+)
+
+// FlowControl selects the handshake scheme used to throttle the remote
+// end, mapped onto the relevant DCB flags on Windows and the
+// CRTSCTS/IXON/IXOFF termios flags on POSIX.
+type FlowControl int
+
+const (
+	FlowNone FlowControl = iota
+	FlowHardware
+	FlowSoftware
+)
+
+// ModemStatus reports the state of the modem control lines as returned
+// by GetCommModemStatus on Windows and TIOCMGET on POSIX.
+type ModemStatus struct {
+	CTS  bool
+	DSR  bool
+	RI   bool
+	RLSD bool
+}
+
+var (
+	ErrBadParity      = errors.New("serial: invalid parity")
+	ErrBadStopBits    = errors.New("serial: invalid stop bits")
+	ErrBadFlowControl = errors.New("serial: invalid flow control")
+)
+
+// CommEventMask is a bitmask of event bits, as understood by
+// SetCommMask/WaitCommEvent on Windows and TIOCMIWAIT on POSIX.
+type CommEventMask uint32
+
+const (
+	EvRxChar  CommEventMask = 0x0001
+	EvTxEmpty CommEventMask = 0x0004
+	EvCTS     CommEventMask = 0x0008
+	EvDSR     CommEventMask = 0x0010
+	EvRLSD    CommEventMask = 0x0020
+	EvBreak   CommEventMask = 0x0040
+	EvErr     CommEventMask = 0x0080
+	EvRing    CommEventMask = 0x0100
+)
+
+// CommErrors reports which line errors were found pending on a CommEvent
+// whose Mask includes EvErr (Windows only; POSIX's TIOCMIWAIT carries no
+// equivalent of ClearCommError).
+type CommErrors struct {
+	Overrun bool
+	Parity  bool
+	Frame   bool
+	Break   bool
+}
+
+// CommEvent is one notification delivered by Port.NotifyEvents.
+type CommEvent struct {
+	Mask   CommEventMask
+	Errors CommErrors
+}
+
+// PortInfo describes one serial port discovered by List, with whatever
+// identifying information the OS exposes for the underlying device.
+type PortInfo struct {
+	Name         string
+	Description  string
+	VID          string
+	PID          string
+	SerialNumber string
+	Manufacturer string
+}
+
+// EventType distinguishes the two events Watch can report.
+type EventType int
+
+const (
+	EventAttach EventType = iota
+	EventDetach
+)
+
+// Event is a single port hot-plug notification delivered by Watch.
+type Event struct {
+	Type EventType
+	Port PortInfo
+}
+
+// Config describes how to open and configure a serial port.
+type Config struct {
+	// Name is the OS device name, e.g. "COM3" or "/dev/ttyUSB0".
+	Name string
+
+	Baud     int
+	DataBits byte
+	Parity   Parity
+	StopBits StopBits
+	Flow     FlowControl
+
+	// RxBufferSize and TxBufferSize size the driver's kernel buffers on
+	// Windows (via SetupComm); a zero value selects DefaultRxBufferSize/
+	// DefaultTxBufferSize. POSIX has no equivalent tunable and ignores
+	// them.
+	RxBufferSize int
+	TxBufferSize int
+
+	// ReadTimeout bounds Read when the caller hasn't set an explicit
+	// deadline with SetReadDeadline/SetDeadline.
+	ReadTimeout time.Duration
+}
+
+// OpenPort opens and configures the named serial port.
+func OpenPort(cfg Config) (*Port, error) {
+	return openPort(cfg.Name, cfg.Baud, cfg.DataBits, cfg.Parity, cfg.StopBits, cfg.Flow, cfg.RxBufferSize, cfg.TxBufferSize, cfg.ReadTimeout)
+}
@@ -0,0 +1,37 @@
+//go:build darwin
+// +build darwin
+
+package serial
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotImplemented is returned by OpenPort on platforms where this
+// package has no Port implementation yet.
+//
+// macOS needs either termios (like serial_posix.go's Linux support) or
+// IOKit for the richer device metadata List/Watch expose; the former
+// was never ported past Linux and the latter needs cgo and a real
+// Darwin toolchain to build and test, neither of which is available in
+// this tree, so it's left unimplemented rather than shipped unverified.
+var ErrNotImplemented = errors.New("serial: not implemented on this platform")
+
+// Port is an unimplemented stand-in so this package still builds on
+// Darwin; every method returns ErrNotImplemented.
+type Port struct{}
+
+func openPort(name string, baud int, databits byte, parity Parity, stopbits StopBits, flow FlowControl, rxBufferSize, txBufferSize int, readTimeout time.Duration) (*Port, error) {
+	return nil, ErrNotImplemented
+}
+
+func (p *Port) Close() error { return ErrNotImplemented }
+
+// Read and WriteContext exist so *Port still satisfies at.Conn on
+// Darwin the same way it does on Linux and Windows; both just report
+// that this platform has no Port implementation.
+func (p *Port) Read([]byte) (int, error) { return 0, ErrNotImplemented }
+
+func (p *Port) WriteContext(context.Context, []byte) (int, error) { return 0, ErrNotImplemented }
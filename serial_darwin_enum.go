@@ -0,0 +1,137 @@
+//go:build darwin
+// +build darwin
+
+package serial
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// List enumerates the serial ports currently present on the system by
+// globbing /dev/cu.* (the non-blocking "caller" device nodes; /dev/tty.*
+// is the blocking counterpart for the same underlying port and would
+// just duplicate every entry).
+//
+// Unlike the Windows and Linux implementations, this does not resolve
+// VID/PID or the USB string descriptors: doing so requires IOKit, which
+// needs cgo and a real macOS toolchain to build and test, neither of
+// which is available here. Only PortInfo.Name is populated.
+func List() ([]PortInfo, error) {
+	matches, err := filepath.Glob("/dev/cu.*")
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make([]PortInfo, len(matches))
+	for i, m := range matches {
+		ports[i] = PortInfo{Name: m}
+	}
+	return ports, nil
+}
+
+// Watch reports serial port attach/detach events until ctx is done, at
+// which point the returned channel is closed. It watches /dev for
+// changes with kqueue (EVFILT_VNODE/NOTE_WRITE fires when an entry is
+// added to or removed from the directory) and re-runs List on each
+// change, diffing against the previous snapshot the same way the
+// Windows and Linux implementations do.
+//
+// This is a coarser signal than the per-device USB arrival/removal
+// notifications IOKit can deliver, but it needs no cgo: opening /dev
+// itself, like opening any other directory, only requires the standard
+// library and golang.org/x/sys/unix.
+func Watch(ctx context.Context) (<-chan Event, error) {
+	kq, err := unix.Kqueue()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Open("/dev")
+	if err != nil {
+		unix.Close(kq)
+		return nil, err
+	}
+
+	changes := []unix.Kevent_t{{
+		Ident:  uint64(dir.Fd()),
+		Filter: unix.EVFILT_VNODE,
+		Flags:  unix.EV_ADD | unix.EV_CLEAR,
+		Fflags: unix.NOTE_WRITE,
+	}}
+	if _, err := unix.Kevent(kq, changes, nil, nil); err != nil {
+		dir.Close()
+		unix.Close(kq)
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer dir.Close()
+		defer unix.Close(kq)
+
+		known, err := List()
+		if err != nil {
+			known = nil
+		}
+		last := byName(known)
+
+		out := make([]unix.Kevent_t, 1)
+		ts := unix.NsecToTimespec(int64(200 * time.Millisecond))
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			n, err := unix.Kevent(kq, nil, out, &ts)
+			if err != nil && err != unix.EINTR {
+				return
+			}
+			if n == 0 {
+				continue
+			}
+
+			cur, err := List()
+			if err != nil {
+				continue
+			}
+			curByName := byName(cur)
+
+			var pending []Event
+			for name, p := range curByName {
+				if _, ok := last[name]; !ok {
+					pending = append(pending, Event{Type: EventAttach, Port: p})
+				}
+			}
+			for name, p := range last {
+				if _, ok := curByName[name]; !ok {
+					pending = append(pending, Event{Type: EventDetach, Port: p})
+				}
+			}
+			last = curByName
+
+			for _, ev := range pending {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func byName(ports []PortInfo) map[string]PortInfo {
+	m := make(map[string]PortInfo, len(ports))
+	for _, p := range ports {
+		m[p.Name] = p
+	}
+	return m
+}
@@ -0,0 +1,167 @@
+//go:build linux
+// +build linux
+
+package serial
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// List enumerates the serial ports currently present on the system by
+// walking /sys/class/tty: an entry with no "device" symlink is a
+// virtual tty (ptmx, tty, console, ...) rather than a real port. VID/PID
+// and the USB string descriptors are filled in by climbing from the
+// backing device up to the nearest ancestor that exposes them (the USB
+// device node, for a USB-serial adapter).
+func List() ([]PortInfo, error) {
+	const sysClassTTY = "/sys/class/tty"
+
+	entries, err := os.ReadDir(sysClassTTY)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []PortInfo
+	for _, e := range entries {
+		devDir, err := filepath.EvalSymlinks(filepath.Join(sysClassTTY, e.Name(), "device"))
+		if err != nil {
+			continue
+		}
+
+		info := PortInfo{Name: "/dev/" + e.Name()}
+		fillUSBInfo(&info, devDir)
+		ports = append(ports, info)
+	}
+	return ports, nil
+}
+
+// fillUSBInfo climbs from dev towards / looking for the sysfs USB device
+// directory (the one with an idVendor file), since the backing tty
+// device is usually several levels below it (e.g. the USB interface and
+// usb-serial glue for a CDC-ACM or FTDI adapter).
+func fillUSBInfo(info *PortInfo, dev string) {
+	for dir := dev; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		vid, err := readSysfsAttr(filepath.Join(dir, "idVendor"))
+		if err != nil {
+			continue
+		}
+		pid, _ := readSysfsAttr(filepath.Join(dir, "idProduct"))
+		info.VID = strings.ToUpper(vid)
+		info.PID = strings.ToUpper(pid)
+		info.Manufacturer, _ = readSysfsAttr(filepath.Join(dir, "manufacturer"))
+		info.Description, _ = readSysfsAttr(filepath.Join(dir, "product"))
+		info.SerialNumber, _ = readSysfsAttr(filepath.Join(dir, "serial"))
+		return
+	}
+}
+
+func readSysfsAttr(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Watch reports serial port attach/detach events until ctx is done, at
+// which point the returned channel is closed. It subscribes to the
+// kernel's NETLINK_KOBJECT_UEVENT multicast group and reports an
+// Attach/Detach for every uevent whose SUBSYSTEM is "tty" and whose
+// DEVNAME names a port List() would also report.
+func Watch(ctx context.Context) (<-chan Event, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	sock := os.NewFile(uintptr(fd), "uevent")
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer sock.Close()
+
+		go func() {
+			<-ctx.Done()
+			sock.SetReadDeadline(time.Now())
+		}()
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := sock.Read(buf)
+			if err != nil {
+				return
+			}
+			ev, ok := parseTTYUevent(buf[:n])
+			if !ok {
+				continue
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseTTYUevent decodes a NETLINK_KOBJECT_UEVENT packet, which is a
+// leading "ACTION@DEVPATH" line followed by NUL-separated KEY=VALUE
+// pairs, into an Event, provided it describes a tty device carrying a
+// DEVNAME. The event's Port is enriched with VID/PID/manufacturer/etc
+// the same way List() is, by resolving DEVPATH's "device" symlink under
+// /sys, so Watch reports the same PortInfo shape on Linux that it does
+// on Windows and macOS.
+func parseTTYUevent(raw []byte) (Event, bool) {
+	var action, devpath, devname, subsystem string
+	for _, field := range bytes.Split(raw, []byte{0}) {
+		kv := strings.SplitN(string(field), "=", 2)
+		if len(kv) != 2 {
+			if action == "" {
+				if i := bytes.IndexByte(field, '@'); i >= 0 {
+					action = string(field[:i])
+				}
+			}
+			continue
+		}
+		switch kv[0] {
+		case "SUBSYSTEM":
+			subsystem = kv[1]
+		case "DEVNAME":
+			devname = kv[1]
+		case "DEVPATH":
+			devpath = kv[1]
+		}
+	}
+
+	if subsystem != "tty" || devname == "" {
+		return Event{}, false
+	}
+
+	info := PortInfo{Name: "/dev/" + devname}
+	if devpath != "" {
+		if devDir, err := filepath.EvalSymlinks(filepath.Join("/sys", devpath, "device")); err == nil {
+			fillUSBInfo(&info, devDir)
+		}
+	}
+
+	switch action {
+	case "add":
+		return Event{Type: EventAttach, Port: info}, true
+	case "remove":
+		return Event{Type: EventDetach, Port: info}, true
+	default:
+		return Event{}, false
+	}
+}
@@ -0,0 +1,290 @@
+//go:build linux
+// +build linux
+
+package serial
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Port is a serial port backed by a POSIX tty configured through
+// termios. Read/Write deadlines are delegated straight to *os.File,
+// which the runtime poller honours for character devices the same way
+// it does for pipes and sockets; there is no analogue of Windows'
+// overlapped I/O or completion port to manage here.
+type Port struct {
+	f *os.File
+
+	rl sync.Mutex
+	wl sync.Mutex
+}
+
+// posixBaud maps the baud rates exposed by Config to the termios speed
+// constants understood by TCSETS; POSIX termios only supports this fixed
+// set rather than an arbitrary integer.
+var posixBaud = map[int]uint32{
+	50: unix.B50, 75: unix.B75, 110: unix.B110, 134: unix.B134, 150: unix.B150,
+	200: unix.B200, 300: unix.B300, 600: unix.B600, 1200: unix.B1200, 1800: unix.B1800,
+	2400: unix.B2400, 4800: unix.B4800, 9600: unix.B9600, 19200: unix.B19200, 38400: unix.B38400,
+	57600: unix.B57600, 115200: unix.B115200, 230400: unix.B230400, 460800: unix.B460800,
+	500000: unix.B500000, 576000: unix.B576000, 921600: unix.B921600, 1000000: unix.B1000000,
+	1152000: unix.B1152000, 1500000: unix.B1500000, 2000000: unix.B2000000, 2500000: unix.B2500000,
+	3000000: unix.B3000000, 3500000: unix.B3500000, 4000000: unix.B4000000,
+}
+
+// rxBufferSize/txBufferSize have no POSIX equivalent (termios exposes no
+// SetupComm-style kernel buffer-size knob) and are accepted only for
+// signature parity with the Windows openPort.
+func openPort(name string, baud int, databits byte, parity Parity, stopbits StopBits, flow FlowControl, rxBufferSize, txBufferSize int, readTimeout time.Duration) (p *Port, err error) {
+	fd, err := unix.Open(name, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), name)
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	if err = setTermios(fd, baud, databits, parity, stopbits, flow); err != nil {
+		return nil, err
+	}
+
+	port := &Port{f: f}
+	if readTimeout > 0 {
+		if err = port.f.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+			return nil, err
+		}
+	}
+	return port, nil
+}
+
+// setTermios programs the tty's termios for baud/framing/flow control
+// and puts it in raw mode: no line editing, no signal-generating
+// characters, no translation of the bytes that pass through.
+func setTermios(fd int, baud int, databits byte, parity Parity, stopbits StopBits, flow FlowControl) error {
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+
+	speed, ok := posixBaud[baud]
+	if !ok {
+		return fmt.Errorf("serial: unsupported baud rate %d", baud)
+	}
+	t.Ispeed, t.Ospeed = speed, speed
+	t.Cflag = t.Cflag&^unix.CBAUD | speed
+
+	t.Cflag &^= unix.CSIZE
+	switch databits {
+	case 5:
+		t.Cflag |= unix.CS5
+	case 6:
+		t.Cflag |= unix.CS6
+	case 7:
+		t.Cflag |= unix.CS7
+	case 8:
+		t.Cflag |= unix.CS8
+	default:
+		return fmt.Errorf("serial: unsupported data bits %d", databits)
+	}
+
+	t.Cflag &^= unix.PARENB | unix.PARODD | unix.CMSPAR
+	switch parity {
+	case ParityNone:
+	case ParityOdd:
+		t.Cflag |= unix.PARENB | unix.PARODD
+	case ParityEven:
+		t.Cflag |= unix.PARENB
+	case ParityMark:
+		t.Cflag |= unix.PARENB | unix.PARODD | unix.CMSPAR
+	case ParitySpace:
+		t.Cflag |= unix.PARENB | unix.CMSPAR
+	default:
+		return ErrBadParity
+	}
+
+	switch stopbits {
+	case Stop1:
+		t.Cflag &^= unix.CSTOPB
+	case Stop2:
+		t.Cflag |= unix.CSTOPB
+	case Stop1Half:
+		return fmt.Errorf("serial: POSIX termios has no 1.5 stop-bit mode")
+	default:
+		return ErrBadStopBits
+	}
+
+	t.Cflag &^= unix.CRTSCTS
+	t.Iflag &^= unix.IXON | unix.IXOFF
+	switch flow {
+	case FlowNone:
+	case FlowHardware:
+		t.Cflag |= unix.CRTSCTS
+	case FlowSoftware:
+		t.Iflag |= unix.IXON | unix.IXOFF
+	default:
+		return ErrBadFlowControl
+	}
+
+	t.Cflag |= unix.CLOCAL | unix.CREAD
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ICANON | unix.ECHO | unix.ECHOE | unix.ISIG
+
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
+
+func (p *Port) Close() error {
+	return p.f.Close()
+}
+
+func (p *Port) SetReadDeadline(t time.Time) error  { return p.f.SetReadDeadline(t) }
+func (p *Port) SetWriteDeadline(t time.Time) error { return p.f.SetWriteDeadline(t) }
+func (p *Port) SetDeadline(t time.Time) error      { return p.f.SetDeadline(t) }
+
+func (p *Port) Read(buf []byte) (int, error) {
+	p.rl.Lock()
+	defer p.rl.Unlock()
+	return p.f.Read(buf)
+}
+
+func (p *Port) Write(buf []byte) (int, error) {
+	p.wl.Lock()
+	defer p.wl.Unlock()
+	return p.f.Write(buf)
+}
+
+// ReadContext is Read, but also unblocked (via a past SetReadDeadline)
+// as soon as ctx is done.
+func (p *Port) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	return p.doIOContext(ctx, p.f.SetReadDeadline, p.Read, buf)
+}
+
+// WriteContext is Write, but also unblocked (via a past
+// SetWriteDeadline) as soon as ctx is done.
+func (p *Port) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	return p.doIOContext(ctx, p.f.SetWriteDeadline, p.Write, buf)
+}
+
+func (p *Port) doIOContext(ctx context.Context, setDeadline func(time.Time) error, do func([]byte) (int, error), buf []byte) (int, error) {
+	if dl, ok := ctx.Deadline(); ok {
+		setDeadline(dl)
+	} else {
+		setDeadline(time.Time{})
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		n, err := do(buf)
+		ch <- result{n, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.n, r.err
+	case <-ctx.Done():
+		setDeadline(time.Now())
+		r := <-ch
+		if r.err == nil {
+			return r.n, nil
+		}
+		return r.n, ctx.Err()
+	}
+}
+
+// Flush discards data written to the port but not transmitted, or data
+// received but not read.
+func (p *Port) Flush() error {
+	return p.control(func(fd int) error {
+		return unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIOFLUSH)
+	})
+}
+
+// SetDTR asserts or clears the DTR (data terminal ready) line.
+func (p *Port) SetDTR(on bool) error {
+	return p.control(func(fd int) error {
+		return setModemBit(fd, unix.TIOCM_DTR, on)
+	})
+}
+
+// SetRTS asserts or clears the RTS (request to send) line.
+func (p *Port) SetRTS(on bool) error {
+	return p.control(func(fd int) error {
+		return setModemBit(fd, unix.TIOCM_RTS, on)
+	})
+}
+
+// SetBreak asserts or clears a break condition on the line.
+func (p *Port) SetBreak(on bool) error {
+	req := unix.TIOCCBRK
+	if on {
+		req = unix.TIOCSBRK
+	}
+	return p.control(func(fd int) error {
+		return unix.IoctlSetInt(fd, uint(req), 0)
+	})
+}
+
+// Status reads the current state of the CTS, DSR, RI and RLSD (carrier
+// detect) modem control lines via TIOCMGET.
+func (p *Port) Status() (ModemStatus, error) {
+	var bits int
+	err := p.control(func(fd int) error {
+		var err error
+		bits, err = unix.IoctlGetInt(fd, unix.TIOCMGET)
+		return err
+	})
+	if err != nil {
+		return ModemStatus{}, err
+	}
+	return ModemStatus{
+		CTS:  bits&unix.TIOCM_CTS != 0,
+		DSR:  bits&unix.TIOCM_DSR != 0,
+		RI:   bits&unix.TIOCM_RI != 0,
+		RLSD: bits&unix.TIOCM_CD != 0,
+	}, nil
+}
+
+// control runs fn with the port's file descriptor, via SyscallConn
+// rather than p.f.Fd(): os.File.Fd() documents that it switches the
+// descriptor to blocking mode and disables the runtime poller for the
+// rest of that File's life, which would silently break every later
+// ReadContext/WriteContext deadline. SyscallConn's Control callback
+// gives the raw fd for the duration of one ioctl without that
+// side effect.
+func (p *Port) control(fn func(fd int) error) error {
+	rc, err := p.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := rc.Control(func(fd uintptr) {
+		fnErr = fn(int(fd))
+	}); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func setModemBit(fd, bit int, on bool) error {
+	req := uint(unix.TIOCMBIC)
+	if on {
+		req = unix.TIOCMBIS
+	}
+	return unix.IoctlSetPointerInt(fd, req, bit)
+}
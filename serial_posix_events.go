@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+package serial
+
+import "golang.org/x/sys/unix"
+
+// NotifyEvents starts a goroutine issuing blocking TIOCMIWAIT calls and
+// pushing a CommEvent for each modem-line transition mask asks about
+// onto the returned channel. The channel is closed when the port is
+// closed.
+//
+// TIOCMIWAIT only reports modem-line transitions, so unlike its Windows
+// counterpart this can only ever deliver EvCTS/EvDSR/EvRLSD/EvRing; bits
+// in mask outside that set (EvRxChar, EvTxEmpty, EvErr) are accepted but
+// never set on a delivered CommEvent, since POSIX has no ioctl
+// equivalent of WaitCommEvent/ClearCommError for them.
+//
+// Unlike Windows' CancelIoEx, TIOCMIWAIT can't be woken up from another
+// goroutine: Close does not fence against a NotifyEvents call blocked
+// inside it, so the goroutine leaks until the next modem-line
+// transition wakes the ioctl and it notices the closed fd and returns.
+func (p *Port) NotifyEvents(mask CommEventMask) (<-chan CommEvent, error) {
+	var wait int
+	if mask&EvCTS != 0 {
+		wait |= unix.TIOCM_CTS
+	}
+	if mask&EvDSR != 0 {
+		wait |= unix.TIOCM_DSR
+	}
+	if mask&EvRLSD != 0 {
+		wait |= unix.TIOCM_CD
+	}
+	if mask&EvRing != 0 {
+		wait |= unix.TIOCM_RNG
+	}
+
+	rc, err := p.f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan CommEvent)
+	go func() {
+		defer close(ch)
+		for {
+			var waitErr, getErr error
+			var bits int
+			err := rc.Control(func(fd uintptr) {
+				waitErr = unix.IoctlSetInt(int(fd), unix.TIOCMIWAIT, wait)
+				if waitErr != nil {
+					return
+				}
+				bits, getErr = unix.IoctlGetInt(int(fd), unix.TIOCMGET)
+			})
+			if err != nil || waitErr != nil || getErr != nil {
+				return
+			}
+			ch <- CommEvent{Mask: decodeModemEventMask(bits) & mask}
+		}
+	}()
+	return ch, nil
+}
+
+func decodeModemEventMask(bits int) CommEventMask {
+	var m CommEventMask
+	if bits&unix.TIOCM_CTS != 0 {
+		m |= EvCTS
+	}
+	if bits&unix.TIOCM_DSR != 0 {
+		m |= EvDSR
+	}
+	if bits&unix.TIOCM_CD != 0 {
+		m |= EvRLSD
+	}
+	if bits&unix.TIOCM_RNG != 0 {
+		m |= EvRing
+	}
+	return m
+}
@@ -1,8 +1,10 @@
+//go:build windows
 // +build windows
 
 package serial
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
@@ -12,15 +14,58 @@ import (
 	"golang.org/x/sys/windows"
 )
 
+// Port is a serial port backed by a Windows COM handle. Reads and writes
+// are issued as overlapped I/O and completed through a single I/O
+// completion port shared by the port, so they can be cancelled or timed
+// out from another goroutine without tearing down the handle.
 type Port struct {
-	f  *os.File
-	fd windows.Handle
+	f    *os.File
+	fd   windows.Handle
+	iocp windows.Handle
+
 	rl sync.Mutex
 	wl sync.Mutex
-	ro *windows.Overlapped
-	wo *windows.Overlapped
+
+	dl            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
+
+	// ops tracks in-flight doIO calls so Close can wait for every
+	// CancelIoEx to have run before freeing the handle: once the handle
+	// is closed, Windows is free to hand the same numeric value to an
+	// unrelated CreateFile, and a CancelIoEx arriving after that would
+	// cancel I/O on the wrong object.
+	ops sync.WaitGroup
 }
 
+// ioOperation is the Windows OVERLAPPED for a single in-flight Read or
+// Write, heap-allocated so it stays alive (and its buffer stays valid)
+// until the completion port reports it done. The Overlapped field must
+// stay first: the dispatch loop recovers the *ioOperation from the
+// *Overlapped handed back by GetQueuedCompletionStatus.
+type ioOperation struct {
+	o  windows.Overlapped
+	ch chan ioResult
+}
+
+type ioResult struct {
+	n   uint32
+	err error
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "serial: I/O timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// ErrTimeout is returned by Read/Write (and their Context variants) when a
+// deadline set with SetReadDeadline/SetWriteDeadline/SetDeadline elapses.
+var ErrTimeout error = timeoutError{}
+
 type structDCB struct {
 	DCBlength, BaudRate                            uint32
 	flags                                          [4]byte
@@ -38,10 +83,28 @@ type structTimeouts struct {
 	WriteTotalTimeoutConstant   uint32
 }
 
-func openPort(name string, baud int, databits byte, parity Parity, stopbits StopBits, readTimeout time.Duration) (p *Port, err error) {
+const (
+	fileSkipSetEventOnHandle        = 0x2
+	fileSkipCompletionPortOnSuccess = 0x1
+)
+
+// Default driver buffer sizes used when openPort is given zero for
+// rxBufferSize/txBufferSize.
+const (
+	DefaultRxBufferSize = 4096
+	DefaultTxBufferSize = 4096
+)
+
+func openPort(name string, baud int, databits byte, parity Parity, stopbits StopBits, flow FlowControl, rxBufferSize, txBufferSize int, readTimeout time.Duration) (p *Port, err error) {
 	if len(name) > 0 && name[0] != '\\' {
 		name = "\\\\.\\" + name
 	}
+	if rxBufferSize <= 0 {
+		rxBufferSize = DefaultRxBufferSize
+	}
+	if txBufferSize <= 0 {
+		txBufferSize = DefaultTxBufferSize
+	}
 
 	h, err := windows.CreateFile(windows.StringToUTF16Ptr(name),
 		windows.GENERIC_READ|windows.GENERIC_WRITE,
@@ -60,56 +123,138 @@ func openPort(name string, baud int, databits byte, parity Parity, stopbits Stop
 		}
 	}()
 
-	if err = setCommState(h, baud, databits, parity, stopbits); err != nil {
+	if err = setCommState(h, baud, databits, parity, stopbits, flow); err != nil {
 		return nil, err
 	}
-	if err = setupComm(h, 64, 64); err != nil {
+	if err = setupComm(h, rxBufferSize, txBufferSize); err != nil {
 		return nil, err
 	}
-	if err = setCommTimeouts(h, readTimeout); err != nil {
+	if err = setCommTimeouts(h); err != nil {
 		return nil, err
 	}
-	if err = setCommMask(h); err != nil {
+	if err = setCommMask(h, uint32(EvRxChar)); err != nil {
 		return nil, err
 	}
 
-	ro, err := newOverlapped()
+	iocp, err := windows.CreateIoCompletionPort(h, 0, 0, 0)
 	if err != nil {
 		return nil, err
 	}
-	wo, err := newOverlapped()
-	if err != nil {
-		return nil, err
+	defer func() {
+		if err != nil {
+			windows.CloseHandle(iocp)
+		}
+	}()
+
+	r, _, cerr := nSetFileCompletionNotificationModes.Call(uintptr(h), fileSkipSetEventOnHandle|fileSkipCompletionPortOnSuccess)
+	if r == 0 {
+		return nil, cerr
 	}
-	port := new(Port)
-	port.f = f
-	port.fd = h
-	port.ro = ro
-	port.wo = wo
+
+	port := &Port{
+		f:    f,
+		fd:   h,
+		iocp: iocp,
+		done: make(chan struct{}),
+	}
+	if readTimeout > 0 {
+		port.readDeadline = time.Now().Add(readTimeout)
+	}
+	go port.dispatch()
 
 	return port, nil
 }
 
+// dispatch runs for the lifetime of the port, pulling completed I/O off
+// the completion port and handing each result to the channel of the
+// ioOperation that started it.
+func (p *Port) dispatch() {
+	for {
+		var n uint32
+		var key uintptr
+		var ov *windows.Overlapped
+		err := windows.GetQueuedCompletionStatus(p.iocp, &n, &key, &ov, windows.INFINITE)
+		if ov == nil {
+			return
+		}
+		op := (*ioOperation)(unsafe.Pointer(ov))
+		op.ch <- ioResult{n: n, err: err}
+	}
+}
+
 func (p *Port) Close() error {
-	err := p.f.Close()
-	windows.CloseHandle(p.ro.HEvent)
-	windows.CloseHandle(p.wo.HEvent)
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.ops.Wait()
+		err = p.f.Close()
+		windows.CloseHandle(p.iocp)
+	})
 	return err
 }
 
+// SetReadDeadline sets the deadline for future Read calls, matching
+// net.Conn semantics. A zero value disables the deadline.
+func (p *Port) SetReadDeadline(t time.Time) error {
+	p.dl.Lock()
+	p.readDeadline = t
+	p.dl.Unlock()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls, matching
+// net.Conn semantics. A zero value disables the deadline.
+func (p *Port) SetWriteDeadline(t time.Time) error {
+	p.dl.Lock()
+	p.writeDeadline = t
+	p.dl.Unlock()
+	return nil
+}
+
+// SetDeadline sets both the read and write deadlines.
+func (p *Port) SetDeadline(t time.Time) error {
+	p.dl.Lock()
+	p.readDeadline = t
+	p.writeDeadline = t
+	p.dl.Unlock()
+	return nil
+}
+
+func (p *Port) currentReadDeadline() time.Time {
+	p.dl.Lock()
+	defer p.dl.Unlock()
+	return p.readDeadline
+}
+
+func (p *Port) currentWriteDeadline() time.Time {
+	p.dl.Lock()
+	defer p.dl.Unlock()
+	return p.writeDeadline
+}
+
 func (p *Port) Write(buf []byte) (int, error) {
 	p.wl.Lock()
 	defer p.wl.Unlock()
 
-	if err := resetEvent(p.wo.HEvent); err != nil {
-		return 0, err
-	}
-	var n uint32
-	err := windows.WriteFile(p.fd, buf, &n, p.wo)
-	if err != nil && err != windows.ERROR_IO_PENDING {
-		return int(n), err
-	}
-	return getOverlappedResult(p.fd, p.wo)
+	return p.doIO(nil, p.currentWriteDeadline(), func(ov *windows.Overlapped) (uint32, error) {
+		var n uint32
+		err := windows.WriteFile(p.fd, buf, &n, ov)
+		return n, err
+	})
+}
+
+// WriteContext is Write, but the operation is also cancelled (via
+// CancelIoEx) as soon as ctx is done.
+func (p *Port) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	p.wl.Lock()
+	defer p.wl.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	return p.doIO(ctx, deadline, func(ov *windows.Overlapped) (uint32, error) {
+		var n uint32
+		err := windows.WriteFile(p.fd, buf, &n, ov)
+		return n, err
+	})
 }
 
 func (p *Port) Read(buf []byte) (int, error) {
@@ -120,15 +265,80 @@ func (p *Port) Read(buf []byte) (int, error) {
 	p.rl.Lock()
 	defer p.rl.Unlock()
 
-	if err := resetEvent(p.ro.HEvent); err != nil {
-		return 0, err
+	return p.doIO(nil, p.currentReadDeadline(), func(ov *windows.Overlapped) (uint32, error) {
+		var n uint32
+		err := windows.ReadFile(p.fd, buf, &n, ov)
+		return n, err
+	})
+}
+
+// ReadContext is Read, but the operation is also cancelled (via
+// CancelIoEx) as soon as ctx is done.
+func (p *Port) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	if p == nil || p.f == nil {
+		return 0, fmt.Errorf("Invalid port on read")
+	}
+
+	p.rl.Lock()
+	defer p.rl.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	return p.doIO(ctx, deadline, func(ov *windows.Overlapped) (uint32, error) {
+		var n uint32
+		err := windows.ReadFile(p.fd, buf, &n, ov)
+		return n, err
+	})
+}
+
+// doIO issues an overlapped operation via issue and waits for it to
+// complete, honouring deadline, ctx (either may be nil/zero) and the
+// port being closed. On timeout, cancellation or close it calls
+// CancelIoEx and still waits for the completion to arrive before
+// returning: the buffer passed to issue must not be reused until then,
+// or the kernel can write into it after the caller has moved on.
+func (p *Port) doIO(ctx context.Context, deadline time.Time, issue func(*windows.Overlapped) (uint32, error)) (int, error) {
+	p.ops.Add(1)
+	defer p.ops.Done()
+
+	op := &ioOperation{ch: make(chan ioResult, 1)}
+
+	n, err := issue(&op.o)
+	if err == nil {
+		// FILE_SKIP_COMPLETION_PORT_ON_SUCCESS means synchronous
+		// completions are never queued, so n is already final.
+		return int(n), nil
 	}
-	var done uint32
-	err := windows.ReadFile(p.fd, buf, &done, p.ro)
-	if err != nil && err != windows.ERROR_IO_PENDING {
-		return int(done), err
+	if err != windows.ERROR_IO_PENDING {
+		return int(n), err
+	}
+
+	var timeoutCh <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	var ctxDone <-chan struct{}
+	if ctx != nil {
+		ctxDone = ctx.Done()
+	}
+
+	select {
+	case res := <-op.ch:
+		return int(res.n), res.err
+	case <-timeoutCh:
+		windows.CancelIoEx(p.fd, &op.o)
+		res := <-op.ch
+		return int(res.n), ErrTimeout
+	case <-ctxDone:
+		windows.CancelIoEx(p.fd, &op.o)
+		res := <-op.ch
+		return int(res.n), ctx.Err()
+	case <-p.done:
+		windows.CancelIoEx(p.fd, &op.o)
+		res := <-op.ch
+		return int(res.n), fmt.Errorf("serial: port closed")
 	}
-	return getOverlappedResult(p.fd, p.ro)
 }
 
 // Discards data written to the port but not transmitted,
@@ -137,12 +347,148 @@ func (p *Port) Flush() error {
 	return purgeComm(p.fd)
 }
 
+// SetDTR asserts or clears the DTR (data terminal ready) line.
+func (p *Port) SetDTR(on bool) error {
+	const SETDTR = 5
+	const CLRDTR = 6
+	return escapeCommFunction(p.fd, on, SETDTR, CLRDTR)
+}
+
+// SetRTS asserts or clears the RTS (request to send) line.
+func (p *Port) SetRTS(on bool) error {
+	const SETRTS = 3
+	const CLRRTS = 4
+	return escapeCommFunction(p.fd, on, SETRTS, CLRRTS)
+}
+
+// SetBreak asserts or clears a break condition on the line.
+func (p *Port) SetBreak(on bool) error {
+	const SETBREAK = 8
+	const CLRBREAK = 9
+	return escapeCommFunction(p.fd, on, SETBREAK, CLRBREAK)
+}
+
+// Status reads the current state of the CTS, DSR, RI and RLSD (carrier
+// detect) modem control lines.
+func (p *Port) Status() (ModemStatus, error) {
+	return getCommModemStatus(p.fd)
+}
+
+// NotifyEvents arms mask via SetCommMask and starts a goroutine issuing
+// overlapped WaitCommEvent calls, decoding each result onto the returned
+// channel. The channel is closed when the port is closed. Only one
+// NotifyEvents loop should run at a time per port, since SetCommMask is
+// port-wide state.
+func (p *Port) NotifyEvents(mask CommEventMask) (<-chan CommEvent, error) {
+	if err := setCommMask(p.fd, uint32(mask)); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan CommEvent)
+	go func() {
+		defer close(ch)
+		for {
+			// p.ops only fences a single doIO call, not this loop as a
+			// whole: doIO's synchronous-completion fast path returns
+			// with the counter back at zero between iterations, so
+			// without this check Close could see ops.Wait() return and
+			// free the handle while we're about to start another
+			// WaitCommEvent on it.
+			select {
+			case <-p.done:
+				return
+			default:
+			}
+
+			var raw uint32
+			_, err := p.doIO(nil, time.Time{}, func(ov *windows.Overlapped) (uint32, error) {
+				r, _, cerr := nWaitCommEvent.Call(uintptr(p.fd), uintptr(unsafe.Pointer(&raw)), uintptr(unsafe.Pointer(ov)))
+				if r != 0 {
+					return 0, nil
+				}
+				return 0, cerr
+			})
+			if err != nil {
+				return
+			}
+
+			ev := CommEvent{Mask: CommEventMask(raw)}
+			if ev.Mask&EvErr != 0 {
+				ev.Errors, _ = clearCommError(p.fd)
+			}
+
+			select {
+			case ch <- ev:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func clearCommError(h windows.Handle) (CommErrors, error) {
+	const (
+		ceOverrun  = 0x0002
+		ceRxParity = 0x0004
+		ceFrame    = 0x0008
+		ceBreak    = 0x0010
+	)
+	var errs uint32
+	r, _, err := nClearCommError.Call(uintptr(h), uintptr(unsafe.Pointer(&errs)), 0)
+	if r == 0 {
+		return CommErrors{}, err
+	}
+	return CommErrors{
+		Overrun: errs&ceOverrun != 0,
+		Parity:  errs&ceRxParity != 0,
+		Frame:   errs&ceFrame != 0,
+		Break:   errs&ceBreak != 0,
+	}, nil
+}
+
+func escapeCommFunction(h windows.Handle, on bool, setFn, clrFn uintptr) error {
+	fn := clrFn
+	if on {
+		fn = setFn
+	}
+	r, _, err := nEscapeCommFunction.Call(uintptr(h), fn)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func getCommModemStatus(h windows.Handle) (ModemStatus, error) {
+	const (
+		msCtsOn  = 0x0010
+		msDsrOn  = 0x0020
+		msRingOn = 0x0040
+		msRlsdOn = 0x0080
+	)
+	var bits uint32
+	r, _, err := nGetCommModemStatus.Call(uintptr(h), uintptr(unsafe.Pointer(&bits)))
+	if r == 0 {
+		return ModemStatus{}, err
+	}
+	return ModemStatus{
+		CTS:  bits&msCtsOn != 0,
+		DSR:  bits&msDsrOn != 0,
+		RI:   bits&msRingOn != 0,
+		RLSD: bits&msRlsdOn != 0,
+	}, nil
+}
+
 var (
 	nSetCommState,
 	nSetCommTimeouts,
 	nSetCommMask,
 	nSetupComm,
-	nGetOverlappedResult,
+	nSetFileCompletionNotificationModes,
+	nEscapeCommFunction,
+	nGetCommModemStatus,
+	nWaitCommEvent,
+	nClearCommError,
 	nPurgeComm *windows.LazyProc
 )
 
@@ -150,20 +496,43 @@ func init() {
 	k32 := windows.NewLazySystemDLL("kernel32.dll")
 
 	nSetCommState = k32.NewProc("SetCommState")
-	nSetCommTimeouts = k32.NewProc( "SetCommTimeouts")
-	nSetCommMask = k32.NewProc( "SetCommMask")
-	nSetupComm = k32.NewProc( "SetupComm")
-	nGetOverlappedResult = k32.NewProc( "GetOverlappedResult")
-	nPurgeComm = k32.NewProc( "PurgeComm")
+	nSetCommTimeouts = k32.NewProc("SetCommTimeouts")
+	nSetCommMask = k32.NewProc("SetCommMask")
+	nSetupComm = k32.NewProc("SetupComm")
+	nSetFileCompletionNotificationModes = k32.NewProc("SetFileCompletionNotificationModes")
+	nEscapeCommFunction = k32.NewProc("EscapeCommFunction")
+	nGetCommModemStatus = k32.NewProc("GetCommModemStatus")
+	nWaitCommEvent = k32.NewProc("WaitCommEvent")
+	nClearCommError = k32.NewProc("ClearCommError")
+	nPurgeComm = k32.NewProc("PurgeComm")
 }
 
-func setCommState(h windows.Handle, baud int, databits byte, parity Parity, stopbits StopBits) error {
+// setCommState programs the DCB, including the flow-control bits: none
+// of them affects fBinary/DTR, which stay asserted the way this port has
+// always opened.
+func setCommState(h windows.Handle, baud int, databits byte, parity Parity, stopbits StopBits, flow FlowControl) error {
 	var params structDCB
 	params.DCBlength = uint32(unsafe.Sizeof(params))
 
 	params.flags[0] = 0x01  // fBinary
 	params.flags[0] |= 0x10 // Assert DSR
 
+	switch flow {
+	case FlowNone:
+		// fOutxCtsFlow/fRtsControl/fOutX/fInX all stay zero.
+	case FlowHardware:
+		const rtsControlHandshake = 0x2
+		params.flags[0] |= 0x04                     // fOutxCtsFlow
+		params.flags[1] |= rtsControlHandshake << 4 // fRtsControl
+	case FlowSoftware:
+		params.flags[1] |= 0x01 // fOutX
+		params.flags[1] |= 0x02 // fInX
+		params.XonChar = 0x11   // DC1
+		params.XoffChar = 0x13  // DC3
+	default:
+		return ErrBadFlowControl
+	}
+
 	params.BaudRate = uint32(baud)
 
 	params.ByteSize = databits
@@ -201,48 +570,16 @@ func setCommState(h windows.Handle, baud int, databits byte, parity Parity, stop
 	return nil
 }
 
-func setCommTimeouts(h windows.Handle, readTimeout time.Duration) error {
+// setCommTimeouts always arms the classic blocking-read timeout scheme.
+// Per-call deadlines are no longer implemented by reissuing this call;
+// doIO enforces them itself via CancelIoEx.
+func setCommTimeouts(h windows.Handle) error {
 	var timeouts structTimeouts
 	const MAXDWORD = 1<<32 - 1
 
-	// blocking read by default
-	var timeoutMs int64 = MAXDWORD - 1
-
-	if readTimeout > 0 {
-		// non-blocking read
-		timeoutMs = readTimeout.Nanoseconds() / 1e6
-		if timeoutMs < 1 {
-			timeoutMs = 1
-		} else if timeoutMs > MAXDWORD-1 {
-			timeoutMs = MAXDWORD - 1
-		}
-	}
-
-	/* From http://msdn.microsoft.com/en-us/library/aa363190(v=VS.85).aspx
-
-		 For blocking I/O see below:
-
-		 Remarks:
-
-		 If an application sets ReadIntervalTimeout and
-		 ReadTotalTimeoutMultiplier to MAXDWORD and sets
-		 ReadTotalTimeoutConstant to a value greater than zero and
-		 less than MAXDWORD, one of the following occurs when the
-		 ReadFile function is called:
-
-		 If there are any bytes in the input buffer, ReadFile returns
-		       immediately with the bytes in the buffer.
-
-		 If there are no bytes in the input buffer, ReadFile waits
-	               until a byte arrives and then returns immediately.
-
-		 If no bytes arrive within the time specified by
-		       ReadTotalTimeoutConstant, ReadFile times out.
-	*/
-
 	timeouts.ReadIntervalTimeout = MAXDWORD
 	timeouts.ReadTotalTimeoutMultiplier = MAXDWORD
-	timeouts.ReadTotalTimeoutConstant = uint32(timeoutMs)
+	timeouts.ReadTotalTimeoutConstant = MAXDWORD - 1
 
 	r, _, err := nSetCommTimeouts.Call(uintptr(h), uintptr(unsafe.Pointer(&timeouts)))
 	if r == 0 {
@@ -259,19 +596,14 @@ func setupComm(h windows.Handle, in, out int) error {
 	return nil
 }
 
-func setCommMask(h windows.Handle) error {
-	const EV_RXCHAR = 0x0001
-	r, _, err := nSetCommMask.Call(uintptr(h), EV_RXCHAR)
+func setCommMask(h windows.Handle, mask uint32) error {
+	r, _, err := nSetCommMask.Call(uintptr(h), uintptr(mask))
 	if r == 0 {
 		return err
 	}
 	return nil
 }
 
-func resetEvent(h windows.Handle) error {
-	return windows.ResetEvent(h)
-}
-
 func purgeComm(h windows.Handle) error {
 	const PURGE_TXABORT = 0x0001
 	const PURGE_RXABORT = 0x0002
@@ -280,34 +612,9 @@ func purgeComm(h windows.Handle) error {
 	r, _, err := nPurgeComm.Call(
 		uintptr(h),
 		PURGE_TXABORT|PURGE_RXABORT|PURGE_TXCLEAR|PURGE_RXCLEAR,
-		)
+	)
 	if r == 0 {
 		return err
 	}
 	return nil
 }
-
-func newOverlapped() (*windows.Overlapped, error) {
-	var overlapped windows.Overlapped
-	h, err := windows.CreateEvent(nil, 1, 0, nil)
-	if err != nil {
-		return nil, err
-	}
-	overlapped.HEvent = h
-	return &overlapped, nil
-}
-
-func getOverlappedResult(h windows.Handle, overlapped *windows.Overlapped) (int, error) {
-	var n int
-	r, _, err := nGetOverlappedResult.Call(
-		uintptr(h),
-		uintptr(unsafe.Pointer(overlapped)),
-		uintptr(unsafe.Pointer(&n)),
-		1,
-		)
-	if r == 0 {
-		return n, err
-	}
-
-	return n, nil
-}
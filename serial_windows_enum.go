@@ -0,0 +1,271 @@
+//go:build windows
+// +build windows
+
+package serial
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+type guid struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+var guidDevinterfaceComport = guid{0x86e0d1e0, 0x8089, 0x11d0, [8]byte{0x9c, 0xe4, 0x08, 0x00, 0x3e, 0x30, 0x1f, 0x73}}
+
+type spDevinfoData struct {
+	cbSize    uint32
+	classGUID guid
+	devInst   uint32
+	reserved  uintptr
+}
+
+const (
+	digcfPresent         = 0x00000002
+	digcfDeviceInterface = 0x00000010
+
+	spdrpHardwareID    = 0x00000001
+	spdrpMfg           = 0x0000000B
+	spdrpFriendlyName  = 0x0000000C
+	spdrpDeviceDesc    = 0x00000000
+	digRegDev          = 0x00000001
+	digclsFlagGlobal   = 0x00000001
+	invalidHandleValue = ^uintptr(0)
+)
+
+var (
+	setupapi = windows.NewLazySystemDLL("setupapi.dll")
+
+	nSetupDiGetClassDevsW              = setupapi.NewProc("SetupDiGetClassDevsW")
+	nSetupDiEnumDeviceInfo             = setupapi.NewProc("SetupDiEnumDeviceInfo")
+	nSetupDiGetDeviceRegistryPropertyW = setupapi.NewProc("SetupDiGetDeviceRegistryPropertyW")
+	nSetupDiGetDeviceInstanceIdW       = setupapi.NewProc("SetupDiGetDeviceInstanceIdW")
+	nSetupDiOpenDevRegKey              = setupapi.NewProc("SetupDiOpenDevRegKey")
+	nSetupDiDestroyDeviceInfoList      = setupapi.NewProc("SetupDiDestroyDeviceInfoList")
+)
+
+// List enumerates the serial ports currently present on the system.
+func List() ([]PortInfo, error) {
+	hDevInfo, _, _ := nSetupDiGetClassDevsW.Call(
+		uintptr(unsafe.Pointer(&guidDevinterfaceComport)),
+		0,
+		0,
+		digcfPresent|digcfDeviceInterface,
+	)
+	if hDevInfo == invalidHandleValue {
+		return nil, fmt.Errorf("serial: SetupDiGetClassDevs failed")
+	}
+	defer nSetupDiDestroyDeviceInfoList.Call(hDevInfo)
+
+	var ports []PortInfo
+	for index := uint32(0); ; index++ {
+		var data spDevinfoData
+		data.cbSize = uint32(unsafe.Sizeof(data))
+		r, _, _ := nSetupDiEnumDeviceInfo.Call(hDevInfo, uintptr(index), uintptr(unsafe.Pointer(&data)))
+		if r == 0 {
+			break
+		}
+
+		port, err := portInfoFromDevice(hDevInfo, &data)
+		if err != nil {
+			continue
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func portInfoFromDevice(hDevInfo uintptr, data *spDevinfoData) (PortInfo, error) {
+	name, err := devRegPortName(hDevInfo, data)
+	if err != nil {
+		return PortInfo{}, err
+	}
+
+	hwID := devRegStringProperty(hDevInfo, data, spdrpHardwareID)
+	vid, pid := parseVIDPID(hwID)
+
+	info := PortInfo{
+		Name:         name,
+		Description:  devRegStringProperty(hDevInfo, data, spdrpFriendlyName),
+		VID:          vid,
+		PID:          pid,
+		Manufacturer: devRegStringProperty(hDevInfo, data, spdrpMfg),
+	}
+	if info.Description == "" {
+		info.Description = devRegStringProperty(hDevInfo, data, spdrpDeviceDesc)
+	}
+	info.SerialNumber = deviceSerialNumber(hDevInfo, data)
+
+	return info, nil
+}
+
+func devRegStringProperty(hDevInfo uintptr, data *spDevinfoData, prop uint32) string {
+	var buf [512]uint16
+	var reqSize uint32
+	r, _, _ := nSetupDiGetDeviceRegistryPropertyW.Call(
+		hDevInfo,
+		uintptr(unsafe.Pointer(data)),
+		uintptr(prop),
+		0,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)*2),
+		uintptr(unsafe.Pointer(&reqSize)),
+	)
+	if r == 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf[:])
+}
+
+func devRegPortName(hDevInfo uintptr, data *spDevinfoData) (string, error) {
+	key, _, _ := nSetupDiOpenDevRegKey.Call(
+		hDevInfo,
+		uintptr(unsafe.Pointer(data)),
+		digclsFlagGlobal,
+		0,
+		digRegDev,
+		uintptr(windows.KEY_READ),
+	)
+	if key == 0 || key == invalidHandleValue {
+		return "", fmt.Errorf("serial: SetupDiOpenDevRegKey failed")
+	}
+	hkey := windows.Handle(key)
+	defer windows.RegCloseKey(hkey)
+
+	var buf [64]uint16
+	bufLen := uint32(len(buf) * 2)
+	var valType uint32
+	err := windows.RegQueryValueEx(
+		hkey,
+		windows.StringToUTF16Ptr("PortName"),
+		nil,
+		&valType,
+		(*byte)(unsafe.Pointer(&buf[0])),
+		&bufLen,
+	)
+	if err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf[:]), nil
+}
+
+// deviceSerialNumber extracts the instance-specific segment of the PnP
+// device instance ID, which for USB CDC-ACM adapters is the device's
+// USB serial number (e.g. "USB\VID_2341&PID_0043\5533731373235121E0B1").
+func deviceSerialNumber(hDevInfo uintptr, data *spDevinfoData) string {
+	var buf [260]uint16
+	var reqSize uint32
+	r, _, _ := nSetupDiGetDeviceInstanceIdW.Call(
+		hDevInfo,
+		uintptr(unsafe.Pointer(data)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		uintptr(unsafe.Pointer(&reqSize)),
+	)
+	if r == 0 {
+		return ""
+	}
+	id := windows.UTF16ToString(buf[:])
+	parts := strings.Split(id, "\\")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+func parseVIDPID(hardwareID string) (vid, pid string) {
+	for _, field := range strings.Split(hardwareID, "&") {
+		field = strings.TrimPrefix(field, "USB\\")
+		switch {
+		case strings.HasPrefix(field, "VID_"):
+			vid = strings.TrimPrefix(field, "VID_")
+		case strings.HasPrefix(field, "PID_"):
+			pid = strings.TrimPrefix(field, "PID_")
+		}
+	}
+	return vid, pid
+}
+
+// Watch reports serial port attach/detach events until ctx is done, at
+// which point the returned channel is closed. It is implemented with a
+// hidden message-only window subscribed to WM_DEVICECHANGE for
+// GUID_DEVINTERFACE_COMPORT; each notification triggers a fresh List()
+// whose result is diffed against the previous snapshot to produce
+// Attach/Detach events, since DBT_DEVICEARRIVAL/DBT_DEVICEREMOVECOMPLETE
+// only carry a device path, not the friendly metadata PortInfo exposes.
+func Watch(ctx context.Context) (<-chan Event, error) {
+	hwnd, notify, err := newDeviceNotificationWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	msgs := make(chan struct{}, 1)
+	setDeviceChangeHandler(hwnd, func() {
+		select {
+		case msgs <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		defer close(events)
+		defer destroyDeviceNotificationWindow(hwnd, notify)
+
+		known, err := List()
+		if err != nil {
+			known = nil
+		}
+		byName := func(ports []PortInfo) map[string]PortInfo {
+			m := make(map[string]PortInfo, len(ports))
+			for _, p := range ports {
+				m[p.Name] = p
+			}
+			return m
+		}
+		last := byName(known)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-msgs:
+				cur, err := List()
+				if err != nil {
+					continue
+				}
+				curByName := byName(cur)
+				var pending []Event
+				for name, p := range curByName {
+					if _, ok := last[name]; !ok {
+						pending = append(pending, Event{Type: EventAttach, Port: p})
+					}
+				}
+				for name, p := range last {
+					if _, ok := curByName[name]; !ok {
+						pending = append(pending, Event{Type: EventDetach, Port: p})
+					}
+				}
+				last = curByName
+
+				for _, ev := range pending {
+					select {
+					case events <- ev:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,224 @@
+//go:build windows
+// +build windows
+
+package serial
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// This file backs Watch with a hidden, message-only window: Windows only
+// delivers WM_DEVICECHANGE to a window's message queue, so hot-plug
+// notification means running a tiny native message loop on its own
+// locked OS thread and bridging WM_DEVICECHANGE back into Go via a
+// per-hwnd callback registered in deviceChangeHandlers.
+
+type wndClassExW struct {
+	cbSize        uint32
+	style         uint32
+	lpfnWndProc   uintptr
+	cbClsExtra    int32
+	cbWndExtra    int32
+	hInstance     windows.Handle
+	hIcon         windows.Handle
+	hCursor       windows.Handle
+	hbrBackground windows.Handle
+	lpszMenuName  *uint16
+	lpszClassName *uint16
+	hIconSm       windows.Handle
+}
+
+type point struct{ x, y int32 }
+
+type msgT struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      point
+}
+
+type devBroadcastDeviceInterface struct {
+	dbccSize       uint32
+	dbccDeviceType uint32
+	dbccReserved   uint32
+	dbccClassGUID  guid
+	dbccName       [1]uint16
+}
+
+const (
+	wmDeviceChange = 0x0219
+	wmDestroy      = 0x0002
+
+	dbtDeviceArrival         = 0x8000
+	dbtDeviceRemoveComplete  = 0x8004
+	dbtDevtypDeviceInterface = 0x00000005
+
+	deviceNotifyWindowHandle = 0x00000000
+)
+
+// HWND_MESSAGE, the parent handle that marks a window as message-only.
+var hwndMessage = ^uintptr(2)
+
+var (
+	user32 = windows.NewLazySystemDLL("user32.dll")
+
+	nRegisterClassExW             = user32.NewProc("RegisterClassExW")
+	nCreateWindowExW              = user32.NewProc("CreateWindowExW")
+	nDefWindowProcW               = user32.NewProc("DefWindowProcW")
+	nDestroyWindow                = user32.NewProc("DestroyWindow")
+	nGetMessageW                  = user32.NewProc("GetMessageW")
+	nTranslateMessage             = user32.NewProc("TranslateMessage")
+	nDispatchMessageW             = user32.NewProc("DispatchMessageW")
+	nPostThreadMessageW           = user32.NewProc("PostThreadMessageW")
+	nRegisterDeviceNotificationW  = user32.NewProc("RegisterDeviceNotificationW")
+	nUnregisterDeviceNotification = user32.NewProc("UnregisterDeviceNotification")
+
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+
+	nGetCurrentThreadId = kernel32.NewProc("GetCurrentThreadId")
+)
+
+var (
+	notifyClassName      = windows.StringToUTF16Ptr("SerialPortNotifyWindowClass")
+	notifyClassOnce      sync.Once
+	notifyClassErr       error
+	deviceChangeMu       sync.Mutex
+	deviceChangeHandlers = map[uintptr]func(){}
+)
+
+func wndProc(hwnd uintptr, message uint32, wParam, lParam uintptr) uintptr {
+	if message == wmDeviceChange && (wParam == dbtDeviceArrival || wParam == dbtDeviceRemoveComplete) {
+		deviceChangeMu.Lock()
+		handler := deviceChangeHandlers[hwnd]
+		deviceChangeMu.Unlock()
+		if handler != nil {
+			handler()
+		}
+		return 1
+	}
+	r, _, _ := nDefWindowProcW.Call(hwnd, uintptr(message), wParam, lParam)
+	return r
+}
+
+func registerNotifyWindowClass() error {
+	notifyClassOnce.Do(func() {
+		var wc wndClassExW
+		wc.cbSize = uint32(unsafe.Sizeof(wc))
+		wc.lpfnWndProc = windows.NewCallback(wndProc)
+		wc.lpszClassName = notifyClassName
+		r, _, err := nRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc)))
+		if r == 0 {
+			notifyClassErr = err
+		}
+	})
+	return notifyClassErr
+}
+
+func setDeviceChangeHandler(hwnd uintptr, fn func()) {
+	deviceChangeMu.Lock()
+	deviceChangeHandlers[hwnd] = fn
+	deviceChangeMu.Unlock()
+}
+
+// newDeviceNotificationWindow creates the hidden message-only window and
+// its message pump on a dedicated, locked OS thread, then registers it
+// for GUID_DEVINTERFACE_COMPORT notifications.
+func newDeviceNotificationWindow() (uintptr, windows.Handle, error) {
+	type created struct {
+		hwnd     uintptr
+		threadID uintptr
+		err      error
+	}
+	out := make(chan created, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		if err := registerNotifyWindowClass(); err != nil {
+			out <- created{err: err}
+			return
+		}
+
+		hwnd, _, _ := nCreateWindowExW.Call(
+			0,
+			uintptr(unsafe.Pointer(notifyClassName)),
+			uintptr(unsafe.Pointer(notifyClassName)),
+			0,
+			0, 0, 0, 0,
+			hwndMessage,
+			0, 0, 0,
+		)
+		if hwnd == 0 {
+			out <- created{err: fmt.Errorf("serial: CreateWindowEx failed")}
+			return
+		}
+		threadID, _, _ := nGetCurrentThreadId.Call()
+		out <- created{hwnd: hwnd, threadID: threadID}
+
+		var m msgT
+		for {
+			r, _, _ := nGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return
+			}
+			if m.message == wmDestroy {
+				return
+			}
+			nTranslateMessage.Call(uintptr(unsafe.Pointer(&m)))
+			nDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+
+	c := <-out
+	if c.err != nil {
+		return 0, 0, c.err
+	}
+
+	var filter devBroadcastDeviceInterface
+	filter.dbccSize = uint32(unsafe.Sizeof(filter))
+	filter.dbccDeviceType = dbtDevtypDeviceInterface
+	filter.dbccClassGUID = guidDevinterfaceComport
+	r, _, err := nRegisterDeviceNotificationW.Call(c.hwnd, uintptr(unsafe.Pointer(&filter)), deviceNotifyWindowHandle)
+	if r == 0 {
+		nPostThreadMessageW.Call(c.threadID, wmDestroy, 0, 0)
+		return 0, 0, err
+	}
+
+	deviceWindowThreads.Lock()
+	deviceWindowThreads.m[c.hwnd] = c.threadID
+	deviceWindowThreads.Unlock()
+
+	return c.hwnd, windows.Handle(r), nil
+}
+
+func destroyDeviceNotificationWindow(hwnd uintptr, notify windows.Handle) {
+	nUnregisterDeviceNotification.Call(uintptr(notify))
+
+	deviceWindowThreads.Lock()
+	threadID := deviceWindowThreads.m[hwnd]
+	delete(deviceWindowThreads.m, hwnd)
+	deviceWindowThreads.Unlock()
+
+	nPostThreadMessageW.Call(threadID, wmDestroy, 0, 0)
+	nDestroyWindow.Call(hwnd)
+
+	deviceChangeMu.Lock()
+	delete(deviceChangeHandlers, hwnd)
+	deviceChangeMu.Unlock()
+}
+
+// deviceWindowThreads maps a notification window to the OS thread
+// running its message pump, so destroyDeviceNotificationWindow (called
+// from an arbitrary goroutine) can ask that specific thread to quit.
+var deviceWindowThreads = struct {
+	sync.Mutex
+	m map[uintptr]uintptr
+}{m: map[uintptr]uintptr{}}